@@ -0,0 +1,304 @@
+/*
+Copyright 2017 The Kedge Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controller implements "kapp controller": a reconcile loop that
+// watches KedgeApp custom resources and keeps the cluster in sync with
+// what their embedded Kedge spec describes, the way `kapp generate` keeps
+// a local manifest in sync today.
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/surajssd/kapp/pkg/spec"
+)
+
+// fieldManager identifies kapp's writes during server-side apply so other
+// controllers' fields are never clobbered.
+const fieldManager = "kapp"
+
+// ConditionType enumerates the status conditions written back onto a
+// KedgeApp, mirroring the Ready/Progressing/Degraded convention used by
+// most operators.
+type ConditionType string
+
+const (
+	ConditionReady       ConditionType = "Ready"
+	ConditionProgressing ConditionType = "Progressing"
+	ConditionDegraded    ConditionType = "Degraded"
+)
+
+// Condition is a single status condition entry on a KedgeApp.
+type Condition struct {
+	Type               ConditionType `json:"type"`
+	Status             string        `json:"status"`
+	Reason             string        `json:"reason,omitempty"`
+	Message            string        `json:"message,omitempty"`
+	LastTransitionTime metav1.Time   `json:"lastTransitionTime,omitempty"`
+}
+
+// Status is written back onto a KedgeApp after each reconcile.
+type Status struct {
+	Conditions        []Condition `json:"conditions,omitempty"`
+	LastGeneratedHash string      `json:"lastGeneratedHash,omitempty"`
+}
+
+// KedgeApp is the CRD this controller watches; its Spec is the same
+// ControllerFields YAML `kapp generate` already consumes.
+type KedgeApp struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   spec.ControllerFields `json:"spec"`
+	Status Status                `json:"status,omitempty"`
+}
+
+// DeepCopyObject implements runtime.Object so a KedgeApp can be handed to
+// the shared informer as its expected object type. Spec is copied via a
+// JSON round-trip since spec.ControllerFields has no hand-rolled DeepCopy of
+// its own; that's also what keeps the informer's cached object and whatever
+// reconcile mutates into it (CreateK8sObjects rewrites Labels/Secrets/Env in
+// place) from aliasing the same backing arrays/maps.
+func (a *KedgeApp) DeepCopyObject() runtime.Object {
+	out := new(KedgeApp)
+	out.TypeMeta = a.TypeMeta
+	out.ObjectMeta = *a.ObjectMeta.DeepCopy()
+	out.Status.Conditions = append([]Condition(nil), a.Status.Conditions...)
+	out.Status.LastGeneratedHash = a.Status.LastGeneratedHash
+
+	specBytes, err := json.Marshal(a.Spec)
+	if err != nil {
+		log.Errorf("could not marshal spec for deep copy of %q: %v", a.Name, err)
+		out.Spec = a.Spec
+		return out
+	}
+	if err := json.Unmarshal(specBytes, &out.Spec); err != nil {
+		log.Errorf("could not unmarshal spec for deep copy of %q: %v", a.Name, err)
+		out.Spec = a.Spec
+	}
+	return out
+}
+
+// KedgeAppList wraps a page of KedgeApps the way a generated clientset's
+// List call would, so cache.ListWatch's ListFunc can return it as a
+// runtime.Object.
+type KedgeAppList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KedgeApp `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object for KedgeAppList.
+func (l *KedgeAppList) DeepCopyObject() runtime.Object {
+	out := new(KedgeAppList)
+	out.TypeMeta = l.TypeMeta
+	out.ListMeta = *l.ListMeta.DeepCopy()
+	out.Items = make([]KedgeApp, len(l.Items))
+	for i := range l.Items {
+		out.Items[i] = *l.Items[i].DeepCopyObject().(*KedgeApp)
+	}
+	return out
+}
+
+// KedgeAppInterface is the subset of a generated CRD client this controller
+// needs; kept narrow so it's trivial to fake in tests.
+type KedgeAppInterface interface {
+	List(opts metav1.ListOptions) ([]KedgeApp, error)
+	Watch(opts metav1.ListOptions) (watch.Interface, error)
+	UpdateStatus(app *KedgeApp) error
+}
+
+// Controller reconciles KedgeApp resources: it regenerates the Kubernetes
+// objects for an app's embedded spec and applies them via server-side
+// apply, then reflects the result back onto the KedgeApp's status.
+type Controller struct {
+	client    kubernetes.Interface
+	kedgeApps KedgeAppInterface
+	informer  cache.SharedIndexInformer
+	queue     workqueue.RateLimitingInterface
+}
+
+// New wires up the shared informer and workqueue for a Controller; call Run
+// to start processing events.
+func New(client kubernetes.Interface, kedgeApps KedgeAppInterface) *Controller {
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				items, err := kedgeApps.List(opts)
+				if err != nil {
+					return nil, err
+				}
+				return &KedgeAppList{Items: items}, nil
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return kedgeApps.Watch(opts)
+			},
+		},
+		&KedgeApp{},
+		30*time.Second,
+		cache.Indexers{},
+	)
+
+	c := &Controller{
+		client:    client,
+		kedgeApps: kedgeApps,
+		informer:  informer,
+		queue:     queue,
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(old, new interface{}) { c.enqueue(new) },
+		DeleteFunc: c.enqueue,
+	})
+
+	return c
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Errorf("could not compute key for object: %v", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// Run starts the informer and the given number of workers, blocking until stopCh closes.
+func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
+	defer c.queue.ShutDown()
+
+	go c.informer.Run(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for informer cache to sync")
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	<-stopCh
+	return nil
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.reconcile(key.(string)); err != nil {
+		log.Errorf("error reconciling %q: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+	return true
+}
+
+// reconcile regenerates the KedgeApp's Kubernetes objects and applies them
+// to the cluster, then writes the resulting status conditions back.
+func (c *Controller) reconcile(key string) error {
+	obj, exists, err := c.informer.GetStore().GetByKey(key)
+	if err != nil {
+		return errors.Wrapf(err, "fetching %q from informer store", key)
+	}
+	if !exists {
+		// The KedgeApp was deleted; owned objects are garbage collected
+		// via their ownerReferences, so there's nothing left to do here.
+		return nil
+	}
+
+	// CreateK8sObjects mutates the spec in place (Labels, Secrets, Env),
+	// so reconcile must work on a copy rather than the informer cache's object.
+	app := obj.(*KedgeApp).DeepCopyObject().(*KedgeApp)
+
+	objects, _, err := app.Spec.CreateK8sObjects()
+	if err != nil {
+		return c.degrade(app, errors.Wrap(err, "generating Kubernetes objects"))
+	}
+
+	if err := c.applyOwned(app, objects); err != nil {
+		return c.degrade(app, errors.Wrap(err, "applying generated objects"))
+	}
+
+	app.Status.Conditions = []Condition{{
+		Type:   ConditionReady,
+		Status: "True",
+		Reason: "ReconcileSuccess",
+	}}
+	return c.kedgeApps.UpdateStatus(app)
+}
+
+// applyOwned server-side-applies each object with the kapp field manager
+// and an ownerReference back to the KedgeApp, so deleting the KedgeApp
+// garbage-collects everything it produced.
+func (c *Controller) applyOwned(app *KedgeApp, objects []runtime.Object) error {
+	owner := metav1.OwnerReference{
+		APIVersion: "kedge.dev/v1alpha1",
+		Kind:       "KedgeApp",
+		Name:       app.Name,
+		UID:        app.UID,
+	}
+
+	for _, obj := range objects {
+		accessor, err := metaAccessor(obj)
+		if err != nil {
+			return err
+		}
+		accessor.SetOwnerReferences(append(accessor.GetOwnerReferences(), owner))
+
+		if err := serverSideApply(c.client, obj, fieldManager); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Controller) degrade(app *KedgeApp, cause error) error {
+	app.Status.Conditions = []Condition{{
+		Type:    ConditionDegraded,
+		Status:  "True",
+		Reason:  "ReconcileError",
+		Message: cause.Error(),
+	}}
+	if err := c.kedgeApps.UpdateStatus(app); err != nil {
+		log.Errorf("failed to update degraded status for %q: %v", app.Name, err)
+	}
+	return cause
+}
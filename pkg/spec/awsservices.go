@@ -0,0 +1,122 @@
+/*
+Copyright 2017 The Kedge Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	api_v1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// AwsService is a single aws-service-operator resource requested from an
+// app, e.g. an S3 bucket or an SQS queue.
+type AwsService struct {
+	Name string `json:"name,omitempty"`
+	// Type picks the aws-service-operator kind to generate: "s3", "sqs",
+	// "sns", "rds" or "dynamodb".
+	Type string `json:"type,omitempty"`
+
+	// Spec is forwarded as-is into the generated CR's spec.
+	Spec map[string]interface{} `json:"spec,omitempty"`
+}
+
+// awsServiceGVK maps an AwsService.Type to the CRD it generates.
+var awsServiceGVK = map[string]struct {
+	group, version, kind, resource string
+}{
+	"s3":       {"s3.services.k8s.aws", "v1alpha1", "Bucket", "buckets"},
+	"sqs":      {"sqs.services.k8s.aws", "v1alpha1", "Queue", "queues"},
+	"sns":      {"sns.services.k8s.aws", "v1alpha1", "Topic", "topics"},
+	"rds":      {"rds.services.k8s.aws", "v1alpha1", "DBInstance", "dbinstances"},
+	"dynamodb": {"dynamodb.services.k8s.aws", "v1alpha1", "Table", "tables"},
+}
+
+// fixAwsServices auto-populates a service's name, the same way fixServices does.
+func fixAwsServices(services []AwsService, appName string) ([]AwsService, error) {
+	for i, s := range services {
+		if s.Name == "" {
+			if len(services) == 1 {
+				s.Name = appName
+			} else {
+				return nil, fmt.Errorf("more than one aws service mentioned, please specify name for each one")
+			}
+		}
+		services[i] = s
+	}
+	return services, nil
+}
+
+func validateAwsServices(services []AwsService) error {
+	seen := make(map[string]bool)
+	for _, s := range services {
+		if _, ok := awsServiceGVK[s.Type]; !ok {
+			return fmt.Errorf("app.awsServices[%s]: unknown type %q", s.Name, s.Type)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("duplicate entry of aws service %q", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
+
+// createAwsServices generates one unstructured CR per app.AwsServices entry,
+// following the aws-service-operator CRD shapes.
+func (app *ControllerFields) createAwsServices() ([]runtime.Object, error) {
+	var objects []runtime.Object
+
+	for _, s := range app.AwsServices {
+		gvk, ok := awsServiceGVK[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("app.awsServices[%s]: unknown type %q", s.Name, s.Type)
+		}
+
+		cr := &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": gvk.group + "/" + gvk.version,
+				"kind":       gvk.kind,
+				"metadata": map[string]interface{}{
+					"name":   s.Name,
+					"labels": app.Labels,
+				},
+				"spec": s.Spec,
+			},
+		}
+		objects = append(objects, cr)
+	}
+	return objects, nil
+}
+
+// awsServiceEnvVars builds the envFrom wiring that exposes each requested
+// service's connection info (bucket name, queue URL, DB endpoint/credentials)
+// to the app's containers, mirroring how app.ConfigMaps/app.Secrets are
+// wired in via envFrom today.
+func awsServiceEnvVars(services []AwsService) []api_v1.EnvFromSource {
+	var envFrom []api_v1.EnvFromSource
+	for _, s := range services {
+		envFrom = append(envFrom, api_v1.EnvFromSource{
+			SecretRef: &api_v1.SecretEnvSource{
+				LocalObjectReference: api_v1.LocalObjectReference{
+					Name: s.Name + "-connection",
+				},
+			},
+		})
+	}
+	return envFrom
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2017 The Kedge Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+	api_v1 "k8s.io/client-go/pkg/api/v1"
+	apps_v1beta1 "k8s.io/client-go/pkg/apis/apps/v1beta1"
+	batch_v1 "k8s.io/client-go/pkg/apis/batch/v1"
+	ext_v1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// KubernetesObjects groups the parsed Kubernetes manifests FromKubernetes
+// collapses into a Kedge App. Exactly one of Deployment/StatefulSet/
+// DaemonSet/Job is expected to carry the workload; the rest are optional
+// satellites of it.
+type KubernetesObjects struct {
+	Deployment  *ext_v1beta1.Deployment
+	StatefulSet *apps_v1beta1.StatefulSet
+	DaemonSet   *ext_v1beta1.DaemonSet
+	Job         *batch_v1.Job
+	Services    []api_v1.Service
+	ConfigMaps  []api_v1.ConfigMap
+	Secrets     []api_v1.Secret
+	PVCs        []api_v1.PersistentVolumeClaim
+}
+
+// workload returns the name and pod template of whichever workload kind was
+// given, since they all carry the same shape (ObjectMeta.Name + a
+// PodTemplateSpec) but don't share an interface to read it through. It is an
+// error for more than one workload kind to be set.
+func (objs KubernetesObjects) workload() (string, api_v1.PodSpec, error) {
+	var set []string
+	if objs.Deployment != nil {
+		set = append(set, "Deployment")
+	}
+	if objs.StatefulSet != nil {
+		set = append(set, "StatefulSet")
+	}
+	if objs.DaemonSet != nil {
+		set = append(set, "DaemonSet")
+	}
+	if objs.Job != nil {
+		set = append(set, "Job")
+	}
+	if len(set) > 1 {
+		return "", api_v1.PodSpec{}, fmt.Errorf("FromKubernetes: more than one workload given (%v), expected exactly one", set)
+	}
+
+	switch {
+	case objs.Deployment != nil:
+		return objs.Deployment.Name, objs.Deployment.Spec.Template.Spec, nil
+	case objs.StatefulSet != nil:
+		return objs.StatefulSet.Name, objs.StatefulSet.Spec.Template.Spec, nil
+	case objs.DaemonSet != nil:
+		return objs.DaemonSet.Name, objs.DaemonSet.Spec.Template.Spec, nil
+	case objs.Job != nil:
+		return objs.Job.Name, objs.Job.Spec.Template.Spec, nil
+	default:
+		return "", api_v1.PodSpec{}, fmt.Errorf("FromKubernetes: no Deployment/StatefulSet/DaemonSet/Job given to convert")
+	}
+}
+
+// FromKubernetes inverts CreateK8sObjects: given a set of already-parsed
+// Kubernetes manifests, it produces the equivalent Kedge App, collapsing
+// the verbose Kubernetes syntax back into the concise Kedge form the way
+// populateServicePortNames/parsePortMapping/convertEnvFromToEnvs/
+// populateVolumes expand it on the way out.
+func FromKubernetes(objs KubernetesObjects) (*App, error) {
+	name, podSpec, err := objs.workload()
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{}
+	app.Name = name
+	app.PodSpec = podSpec
+
+	containers, err := containersFromKubernetes(app.PodSpec.Containers, objs.ConfigMaps, objs.Secrets)
+	if err != nil {
+		return nil, errors.Wrap(err, "collapsing containers")
+	}
+	app.Containers = containers
+
+	app.Services = servicesFromKubernetes(objs.Services)
+
+	for _, cm := range objs.ConfigMaps {
+		app.ConfigMaps = append(app.ConfigMaps, ConfigMapMod{
+			Name: cm.Name,
+			Data: cm.Data,
+		})
+	}
+
+	for _, sec := range objs.Secrets {
+		app.Secrets = append(app.Secrets, SecretMod{
+			Name:       sec.Name,
+			Data:       sec.Data,
+			StringData: sec.StringData,
+			Type:       sec.Type,
+		})
+	}
+
+	for _, pvc := range objs.PVCs {
+		app.VolumeClaims = append(app.VolumeClaims, VolumeClaim{
+			Name:                      pvc.Name,
+			AccessModes:               pvc.Spec.AccessModes,
+			PersistentVolumeClaimSpec: PersistentVolumeClaimSpec(pvc.Spec),
+		})
+	}
+
+	return app, nil
+}
+
+// containersFromKubernetes is the inverse of populateContainers: it
+// re-collapses a container's envs into one envFrom entry per ConfigMap/Secret
+// whose keys they fully enumerate (see collapseEnvFrom), and
+// re-merges health→probes when readiness and liveness point at the same probe.
+func containersFromKubernetes(containers []api_v1.Container, cms []api_v1.ConfigMap, secrets []api_v1.Secret) ([]Container, error) {
+	var out []Container
+
+	for _, kc := range containers {
+		c := Container{Container: kc}
+
+		envFrom, remaining, err := collapseEnvFrom(kc.Env, cms, secrets)
+		if err != nil {
+			return nil, errors.Wrapf(err, "container %q", kc.Name)
+		}
+		c.EnvFrom = envFrom
+		c.Env = remaining
+
+		if kc.LivenessProbe != nil && kc.ReadinessProbe != nil &&
+			probesEqual(kc.LivenessProbe, kc.ReadinessProbe) {
+			c.Health = kc.LivenessProbe
+			c.LivenessProbe = nil
+			c.ReadinessProbe = nil
+		}
+
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// collapseEnvFrom detects when a container's plain envs fully enumerate a
+// known ConfigMap's or Secret's keys and, if so, re-collapses them into a
+// single envFrom entry, leaving anything that doesn't round-trip losslessly
+// as plain envs.
+func collapseEnvFrom(envs []api_v1.EnvVar, cms []api_v1.ConfigMap, secrets []api_v1.Secret) ([]api_v1.EnvFromSource, []api_v1.EnvVar, error) {
+	bySource := make(map[string][]api_v1.EnvVar)
+	var ungrouped []api_v1.EnvVar
+
+	for _, e := range envs {
+		switch {
+		case e.ValueFrom != nil && e.ValueFrom.ConfigMapKeyRef != nil:
+			bySource["configmap/"+e.ValueFrom.ConfigMapKeyRef.Name] = append(
+				bySource["configmap/"+e.ValueFrom.ConfigMapKeyRef.Name], e)
+		case e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil:
+			bySource["secret/"+e.ValueFrom.SecretKeyRef.Name] = append(
+				bySource["secret/"+e.ValueFrom.SecretKeyRef.Name], e)
+		default:
+			ungrouped = append(ungrouped, e)
+		}
+	}
+
+	var envFrom []api_v1.EnvFromSource
+	for key, grouped := range bySource {
+		var name string
+		var isSecret bool
+		if len(key) > len("configmap/") && key[:len("configmap/")] == "configmap/" {
+			name = key[len("configmap/"):]
+		} else {
+			name = key[len("secret/"):]
+			isSecret = true
+		}
+
+		if !isSecret && allKeysPresent(grouped, configMapKeys(cms, name)) {
+			envFrom = append(envFrom, api_v1.EnvFromSource{
+				ConfigMapRef: &api_v1.ConfigMapEnvSource{LocalObjectReference: api_v1.LocalObjectReference{Name: name}},
+			})
+			continue
+		}
+		if isSecret && allKeysPresent(grouped, secretKeys(secrets, name)) {
+			envFrom = append(envFrom, api_v1.EnvFromSource{
+				SecretRef: &api_v1.SecretEnvSource{LocalObjectReference: api_v1.LocalObjectReference{Name: name}},
+			})
+			continue
+		}
+		// doesn't round-trip losslessly; keep as plain envs instead
+		ungrouped = append(ungrouped, grouped...)
+	}
+
+	return envFrom, ungrouped, nil
+}
+
+func allKeysPresent(envs []api_v1.EnvVar, keys []string) bool {
+	if len(envs) != len(keys) {
+		return false
+	}
+	have := make(map[string]bool, len(envs))
+	for _, e := range envs {
+		have[e.Name] = true
+	}
+	for _, k := range keys {
+		if !have[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func configMapKeys(cms []api_v1.ConfigMap, name string) []string {
+	for _, cm := range cms {
+		if cm.Name == name {
+			keys := getMapKeys(cm.Data)
+			sort.Strings(keys)
+			return keys
+		}
+	}
+	return nil
+}
+
+func secretKeys(secrets []api_v1.Secret, name string) []string {
+	for _, sec := range secrets {
+		if sec.Name == name {
+			var keys []string
+			for k := range sec.Data {
+				keys = append(keys, k)
+			}
+			for k := range sec.StringData {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys
+		}
+	}
+	return nil
+}
+
+func probesEqual(a, b *api_v1.Probe) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// servicesFromKubernetes re-derives ServiceSpecMod entries, reconstructing
+// `port:targetPort/protocol` strings only when a port round-trips
+// losslessly (i.e. it has no user-chosen name that parsePortMapping can't
+// represent); anything else is kept as a full ServicePortMod.
+func servicesFromKubernetes(svcs []api_v1.Service) []ServiceSpecMod {
+	var out []ServiceSpecMod
+
+	for _, svc := range svcs {
+		s := ServiceSpecMod{
+			Name:        svc.Name,
+			ServiceSpec: svc.Spec,
+			Headless:    svc.Spec.ClusterIP == api_v1.ClusterIPNone,
+		}
+		s.ServiceSpec.Ports = nil
+
+		for _, p := range svc.Spec.Ports {
+			if p.Name == "" || p.Name == fmt.Sprintf("%s-%d", svc.Name, p.Port) {
+				s.PortMappings = append(s.PortMappings, portMappingString(p))
+				continue
+			}
+			s.Ports = append(s.Ports, ServicePortMod{ServicePort: p})
+		}
+
+		out = append(out, s)
+	}
+	return out
+}
+
+func portMappingString(p api_v1.ServicePort) string {
+	pm := fmt.Sprintf("%d", p.Port)
+	if p.NodePort != 0 {
+		pm = fmt.Sprintf("%s:%s:%d", pm, p.TargetPort.String(), p.NodePort)
+	} else if p.TargetPort.String() != "" && p.TargetPort.String() != pm {
+		pm = fmt.Sprintf("%s:%s", pm, p.TargetPort.String())
+	}
+	if p.Protocol != "" && p.Protocol != api_v1.ProtocolTCP {
+		pm = fmt.Sprintf("%s/%s", pm, p.Protocol)
+	}
+	return pm
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2017 The Kedge Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	api_v1 "k8s.io/client-go/pkg/api/v1"
+
+	build_v1 "github.com/openshift/origin/pkg/build/apis/build/v1"
+	deploy_v1 "github.com/openshift/origin/pkg/deploy/apis/apps/v1"
+	image_v1 "github.com/openshift/origin/pkg/image/apis/image/v1"
+	route_v1 "github.com/openshift/origin/pkg/route/apis/route/v1"
+)
+
+// StrategyDeploymentConfig selects the OpenShift DeploymentConfig code path
+// instead of the default Kubernetes Deployment.
+const StrategyDeploymentConfig = "deploymentconfig"
+
+// Route mirrors the subset of route.openshift.io/v1 Route users configure
+// from a Kedge app, the OpenShift analogue of app.Ingresses.
+type Route struct {
+	Name           string                      `json:"name,omitempty"`
+	Host           string                      `json:"host,omitempty"`
+	Path           string                      `json:"path,omitempty"`
+	TargetPort     string                      `json:"targetPort,omitempty"`
+	Weight         *int32                      `json:"weight,omitempty"`
+	WildcardPolicy route_v1.WildcardPolicyType `json:"wildcardPolicy,omitempty"`
+	TLS            *route_v1.TLSConfig         `json:"tls,omitempty"`
+}
+
+// Build describes a BuildConfig+ImageStream pair generated from a Git source.
+type Build struct {
+	Name         string `json:"name,omitempty"`
+	GitURI       string `json:"gitURI,omitempty"`
+	GitRef       string `json:"gitRef,omitempty"`
+	ContextDir   string `json:"contextDir,omitempty"`
+	Strategy     string `json:"strategy,omitempty"` // "source" or "docker"
+	BuilderImage string `json:"builderImage,omitempty"`
+	Output       string `json:"output,omitempty"` // ImageStreamTag, e.g. "myapp:latest"
+}
+
+// fixRoutes auto-populates a route's name the same way fixServices does.
+func fixRoutes(routes []Route, appName string) ([]Route, error) {
+	for i, r := range routes {
+		if r.Name == "" {
+			if len(routes) == 1 {
+				r.Name = appName
+			} else {
+				return nil, errors.New("more than one route mentioned, please specify name for each one")
+			}
+		}
+		routes[i] = r
+	}
+	return routes, nil
+}
+
+func (app *ControllerFields) createRoutes() ([]runtime.Object, error) {
+	var routes []runtime.Object
+
+	for _, r := range app.Routes {
+		route := &route_v1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   r.Name,
+				Labels: app.Labels,
+			},
+			Spec: route_v1.RouteSpec{
+				Host:           r.Host,
+				Path:           r.Path,
+				WildcardPolicy: r.WildcardPolicy,
+				TLS:            r.TLS,
+				To: route_v1.RouteTargetReference{
+					Kind: "Service",
+					Name: app.Name,
+				},
+			},
+		}
+		if r.TargetPort != "" {
+			route.Spec.Port = &route_v1.RoutePort{
+				TargetPort: intstr.Parse(r.TargetPort),
+			}
+		}
+		if r.Weight != nil {
+			route.Spec.To.Weight = r.Weight
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// createDeploymentConfig is the OpenShift equivalent of a Deployment,
+// triggered with ConfigChange and an ImageChange on the app's own
+// ImageStreamTag.
+func (app *ControllerFields) createDeploymentConfig() (runtime.Object, error) {
+	dc := &deploy_v1.DeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   app.Name,
+			Labels: app.Labels,
+		},
+		Spec: deploy_v1.DeploymentConfigSpec{
+			Selector: app.Labels,
+			Template: &api_v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: app.Labels},
+				Spec:       app.PodSpec,
+			},
+			Triggers: deploy_v1.DeploymentTriggerPolicies{
+				{Type: deploy_v1.DeploymentTriggerOnConfigChange},
+			},
+		},
+	}
+
+	for _, c := range app.PodSpec.Containers {
+		dc.Spec.Triggers = append(dc.Spec.Triggers, deploy_v1.DeploymentTriggerPolicy{
+			Type: deploy_v1.DeploymentTriggerOnImageChange,
+			ImageChangeParams: &deploy_v1.DeploymentTriggerImageChangeParams{
+				Automatic:      true,
+				ContainerNames: []string{c.Name},
+				From: api_v1.ObjectReference{
+					Kind: "ImageStreamTag",
+					Name: fmt.Sprintf("%s:latest", c.Name),
+				},
+			},
+		})
+	}
+
+	return dc, nil
+}
+
+// CreateControllerObject returns the workload object for this app: an
+// OpenShift DeploymentConfig when app.Strategy is StrategyDeploymentConfig,
+// or nil for the default strategy, since the default Kubernetes Deployment
+// isn't built here. CreateK8sObjects calls this and appends whatever it
+// returns to the objects it assembles itself.
+func (app *ControllerFields) CreateControllerObject() (runtime.Object, error) {
+	switch app.Strategy {
+	case StrategyDeploymentConfig:
+		return app.createDeploymentConfig()
+	case "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("app.strategy: unknown strategy %q, only %q is supported", app.Strategy, StrategyDeploymentConfig)
+	}
+}
+
+func (app *ControllerFields) createBuilds() ([]runtime.Object, error) {
+	var objects []runtime.Object
+
+	for _, b := range app.Builds {
+		if b.Name == "" {
+			return nil, fmt.Errorf("name not specified for app.builds")
+		}
+
+		strategy := build_v1.BuildStrategy{}
+		switch b.Strategy {
+		case "docker", "":
+			strategy.DockerStrategy = &build_v1.DockerBuildStrategy{}
+		case "source":
+			strategy.SourceStrategy = &build_v1.SourceBuildStrategy{
+				From: api_v1.ObjectReference{
+					Kind: "ImageStreamTag",
+					Name: b.BuilderImage,
+				},
+			}
+		default:
+			return nil, fmt.Errorf("app.builds[%s]: unknown strategy %q, must be 'source' or 'docker'", b.Name, b.Strategy)
+		}
+
+		bc := &build_v1.BuildConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   b.Name,
+				Labels: app.Labels,
+			},
+			Spec: build_v1.BuildConfigSpec{
+				CommonSpec: build_v1.CommonSpec{
+					Source: build_v1.BuildSource{
+						Git: &build_v1.GitBuildSource{
+							URI: b.GitURI,
+							Ref: b.GitRef,
+						},
+						ContextDir: b.ContextDir,
+					},
+					Strategy: strategy,
+					Output: build_v1.BuildOutput{
+						To: &api_v1.ObjectReference{
+							Kind: "ImageStreamTag",
+							Name: b.Output,
+						},
+					},
+				},
+			},
+		}
+
+		is := &image_v1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   b.Name,
+				Labels: app.Labels,
+			},
+		}
+
+		objects = append(objects, bc, is)
+	}
+	return objects, nil
+}
@@ -24,7 +24,6 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/client-go/pkg/api"
 	api_v1 "k8s.io/client-go/pkg/api/v1"
 	"strconv"
 	"strings"
@@ -33,14 +32,136 @@ import (
 func populateServicePortNames(serviceName string, servicePorts []api_v1.ServicePort) {
 	// auto populate port names if more than 1 port specified
 	if len(servicePorts) > 1 {
+		seen := make(map[string]bool)
+		for _, sp := range servicePorts {
+			if sp.Name != "" {
+				seen[sp.Name] = true
+			}
+		}
+
 		for i := range servicePorts {
 			// Only populate if the port name is not already specified
-			if len(servicePorts[i].Name) == 0 {
-				servicePorts[i].Name = serviceName + "-" + strconv.FormatInt(int64(servicePorts[i].Port), 10)
-				fmt.Println(servicePorts[i].Name)
+			if len(servicePorts[i].Name) != 0 {
+				continue
+			}
+
+			base := serviceName + "-" + strconv.FormatInt(int64(servicePorts[i].Port), 10)
+			name := base
+			if seen[name] {
+				// Kubernetes requires unique names; disambiguate entries
+				// that share a numeric port but differ by protocol.
+				name = base + "-" + strings.ToLower(string(servicePorts[i].Protocol))
+			}
+			// If that's still taken (e.g. a user-supplied name already
+			// claimed it, or three ports share the same numeric port),
+			// keep appending a counter until it's unique.
+			for n := 2; seen[name]; n++ {
+				name = fmt.Sprintf("%s-%s-%d", base, strings.ToLower(string(servicePorts[i].Protocol)), n)
+			}
+			servicePorts[i].Name = name
+			seen[name] = true
+		}
+	}
+}
+
+// downwardAPIFieldRefs is the set of pod/container field paths we allow
+// users to reference through the `fieldRef(...)` shorthand.
+var downwardAPIFieldRefs = map[string]bool{
+	"metadata.name":           true,
+	"metadata.namespace":      true,
+	"metadata.labels":         true,
+	"metadata.annotations":    true,
+	"spec.nodeName":           true,
+	"spec.serviceAccountName": true,
+	"status.hostIP":           true,
+	"status.podIP":            true,
+	"status.podIPs":           true,
+}
+
+// downwardAPIResourceFieldRefs is the set of container resource field
+// paths allowed through the `resourceFieldRef(...)` shorthand.
+var downwardAPIResourceFieldRefs = map[string]bool{
+	"limits.cpu":      true,
+	"limits.memory":   true,
+	"requests.cpu":    true,
+	"requests.memory": true,
+}
+
+// populateDownwardAPIEnv expands the `fieldRef(path)`/`resourceFieldRef(path)`
+// shorthand in a container's env values into full EnvVarSource structs, the
+// same way populateEnvFrom expands envFrom into plain EnvVars.
+func populateDownwardAPIEnv(c Container) (Container, error) {
+	for i, e := range c.Env {
+		switch {
+		case strings.HasPrefix(e.Value, "fieldRef(") && strings.HasSuffix(e.Value, ")"):
+			path := strings.TrimSuffix(strings.TrimPrefix(e.Value, "fieldRef("), ")")
+			if !downwardAPIFieldRefs[path] {
+				return c, fmt.Errorf("env %q: unsupported fieldRef path %q", e.Name, path)
+			}
+			c.Env[i] = api_v1.EnvVar{
+				Name: e.Name,
+				ValueFrom: &api_v1.EnvVarSource{
+					FieldRef: &api_v1.ObjectFieldSelector{FieldPath: path},
+				},
+			}
+		case strings.HasPrefix(e.Value, "resourceFieldRef(") && strings.HasSuffix(e.Value, ")"):
+			path := strings.TrimSuffix(strings.TrimPrefix(e.Value, "resourceFieldRef("), ")")
+			if !downwardAPIResourceFieldRefs[path] {
+				return c, fmt.Errorf("env %q: unsupported resourceFieldRef path %q", e.Name, path)
 			}
+			c.Env[i] = api_v1.EnvVar{
+				Name: e.Name,
+				ValueFrom: &api_v1.EnvVarSource{
+					ResourceFieldRef: &api_v1.ResourceFieldSelector{Resource: path},
+				},
+			}
+		}
+	}
+	return c, nil
+}
+
+// headlessEnvVarNames are the env var names headlessServiceEnvVars injects,
+// used to strip a previous run's injection before re-injecting.
+var headlessEnvVarNames = []string{"POD_NAME", "SERVICE_NAME"}
+
+// headlessServiceEnvVars injects POD_NAME/SERVICE_NAME into every container
+// when at least one of the app's services is Headless, so StatefulSet
+// peer-discovery patterns work without users writing the downward API
+// fieldRef syntax by hand.
+func headlessServiceEnvVars(services []ServiceSpecMod) []api_v1.EnvVar {
+	for _, s := range services {
+		if !s.Headless {
+			continue
+		}
+		return []api_v1.EnvVar{
+			{
+				Name: "POD_NAME",
+				ValueFrom: &api_v1.EnvVarSource{
+					FieldRef: &api_v1.ObjectFieldSelector{FieldPath: "metadata.name"},
+				},
+			},
+			{Name: "SERVICE_NAME", Value: s.Name},
+		}
+	}
+	return nil
+}
+
+// removeEnvVars returns envs with any entry named in names dropped,
+// preserving order of what's left.
+func removeEnvVars(envs []api_v1.EnvVar, names []string) []api_v1.EnvVar {
+	drop := make(map[string]bool, len(names))
+	for _, n := range names {
+		drop[n] = true
+	}
+
+	var out []api_v1.EnvVar
+	for _, e := range envs {
+		if drop[e.Name] {
+			continue
 		}
+		out = append(out, e)
 	}
+	return out
 }
 
 func populateProbes(c Container) (Container, error) {
@@ -167,57 +288,56 @@ func populateEnvFrom(c Container, cms []ConfigMapMod, secrets []SecretMod) (Cont
 	return c, nil
 }
 
-// Parse the string the get the port, targetPort and protocol
+// Parse the string the get the port, targetPort, nodePort and protocol
 // information, and then return the resulting ServicePort object
 func parsePortMapping(pm string) (*api_v1.ServicePort, error) {
 
-	// The current syntax for portMapping is - port:targetPort/protocol
-	// The only field mandatory here is "port". There are 4 possible cases here
-	// which are handled in this function.
+	// The syntax for portMapping is - port:targetPort:nodePort/protocol
+	// The only field mandatory here is "port". targetPort may be a name
+	// (e.g. "http") instead of a number, in which case it is kept as a
+	// string the same way a SRV record names its target. There are 6
+	// possible cases here which are handled in this function.
 
 	// Case 1 - port
 	// Case 2 - port:targetPort
-	// Case 3 - port/protocol
-	// Case 4 - port:targetPort/protocol
+	// Case 3 - port:targetPort:nodePort
+	// Case 4 - port/protocol
+	// Case 5 - port:targetPort/protocol
+	// Case 6 - port:targetPort:nodePort/protocol
 
 	var port int32
 	var targetPort intstr.IntOrString
+	var nodePort int32
 	var protocol api_v1.Protocol
 
 	protocolSplit := strings.Split(pm, "/")
 	switch len(protocolSplit) {
 
 	// When no protocol is specified, we set the protocol to TCP
-	// Case 1 - port
-	// Case 2 - port:targetPort
 	case 1:
 		protocol = api_v1.ProtocolTCP
 
 	// When protocol is specified
-	// Case 3 - port/protocol
-	// Case 4 - port:targetPort/protocol
 	case 2:
 		switch api_v1.Protocol(protocolSplit[1]) {
-		case api_v1.ProtocolTCP, api_v1.ProtocolUDP:
+		case api_v1.ProtocolTCP, api_v1.ProtocolUDP, api_v1.ProtocolSCTP:
 			protocol = api_v1.Protocol(protocolSplit[1])
 		default:
-			return nil, fmt.Errorf("invalid protocol '%v' provided, the acceptable values are '%v' and '%v'", protocolSplit[1], api.ProtocolTCP, api.ProtocolUDP)
+			return nil, fmt.Errorf("invalid protocol '%v' provided, the acceptable values are '%v', '%v' and '%v'",
+				protocolSplit[1], api_v1.ProtocolTCP, api_v1.ProtocolUDP, api_v1.ProtocolSCTP)
 		}
 	// There is no case in which splitting by "/" provides < 1 or > 2 values
 	default:
-		return nil, fmt.Errorf("invalid syntax for protocol '%v' provided, use 'port:targetPort/protocol'", pm)
+		return nil, fmt.Errorf("invalid syntax for protocol '%v' provided, use 'port:targetPort:nodePort/protocol'", pm)
 	}
 
-	portSplit := strings.Split(pm, ":")
+	portSplit := strings.Split(protocolSplit[0], ":")
 	switch len(portSplit) {
 
 	// When only port is specified
 	// Case 1 - port
-	// Case 3 - port/protocol
 	case 1:
-		// Ignoring the protocol part, if present, and converting only the port
-		// part
-		p, err := strconv.ParseInt(strings.Split(portSplit[0], "/")[0], 10, 32)
+		p, err := strconv.ParseInt(portSplit[0], 10, 32)
 		if err != nil {
 			return nil, errors.Wrap(err, "port is not an int")
 		}
@@ -226,48 +346,91 @@ func parsePortMapping(pm string) (*api_v1.ServicePort, error) {
 
 	// When port and targetPort both are specified
 	// Case 2 - port:targetPort
-	// Case 4 - port:targetPort/protocol
 	case 2:
 		p, err := strconv.ParseInt(portSplit[0], 10, 32)
 		if err != nil {
 			return nil, errors.Wrap(err, "port is not an int")
 		}
 		port = int32(p)
+		targetPort = parseTargetPort(portSplit[1])
+
+	// When port, targetPort and nodePort are all specified
+	// Case 3 - port:targetPort:nodePort
+	case 3:
+		p, err := strconv.ParseInt(portSplit[0], 10, 32)
+		if err != nil {
+			return nil, errors.Wrap(err, "port is not an int")
+		}
+		port = int32(p)
+		targetPort = parseTargetPort(portSplit[1])
 
-		// Ignoring the protocol part, if present, and converting only the
-		// targetPort part
-		tp, err := strconv.ParseInt(strings.Split(portSplit[1], "/")[0], 10, 32)
+		np, err := strconv.ParseInt(portSplit[2], 10, 32)
 		if err != nil {
-			return nil, errors.Wrap(err, "targetPort is not an int")
+			return nil, errors.Wrap(err, "nodePort is not an int")
 		}
-		targetPort.IntVal = int32(tp)
+		nodePort = int32(np)
 
-	// There is no case in which splitting by ": provides < 1 or > 2 values
+	// There is no case in which splitting by ":" provides < 1 or > 3 values
 	default:
-		return nil, fmt.Errorf("invalid syntax for portMapping '%v', use 'port:targetPort/protocol'", pm)
+		return nil, fmt.Errorf("invalid syntax for portMapping '%v', use 'port:targetPort:nodePort/protocol'", pm)
 	}
 
 	return &api_v1.ServicePort{
 		Port:       port,
 		TargetPort: targetPort,
+		NodePort:   nodePort,
 		Protocol:   protocol,
 	}, nil
 }
 
-func populateContainers(containers []Container, cms []ConfigMapMod, secrets []SecretMod) ([]api_v1.Container, error) {
+// parseTargetPort converts a targetPort token into an intstr.IntOrString,
+// keeping it as a named string (e.g. "http", "dns") when it isn't numeric,
+// the way a named container port is referenced instead of its number.
+func parseTargetPort(s string) intstr.IntOrString {
+	if tp, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return intstr.FromInt(int(tp))
+	}
+	return intstr.FromString(s)
+}
+
+func populateContainers(containers []Container, cms []ConfigMapMod, secrets []SecretMod,
+	defaultResources ResourceSpec, defaultSecurity SecuritySpec) ([]api_v1.Container, map[string]string, error) {
 	var cnts []api_v1.Container
+	annotations := map[string]string{}
 
 	for cn, c := range containers {
 		// process health field
 		c, err := populateProbes(c)
 		if err != nil {
-			return cnts, errors.Wrapf(err, "error converting 'health' to 'probes', app.containers[%d]", cn)
+			return cnts, nil, errors.Wrapf(err, "error converting 'health' to 'probes', app.containers[%d]", cn)
 		}
 
 		// process envFrom field
 		c, err = populateEnvFrom(c, cms, secrets)
 		if err != nil {
-			return cnts, fmt.Errorf("error converting 'envFrom' to 'envs', app.containers[%d].%s", cn, err.Error())
+			return cnts, nil, fmt.Errorf("error converting 'envFrom' to 'envs', app.containers[%d].%s", cn, err.Error())
+		}
+
+		// process fieldRef/resourceFieldRef shorthand
+		c, err = populateDownwardAPIEnv(c)
+		if err != nil {
+			return cnts, nil, errors.Wrapf(err, "app.containers[%d]", cn)
+		}
+
+		// process human-readable cpus/memory shorthand
+		c, err = populateResources(c, defaultResources)
+		if err != nil {
+			return cnts, nil, errors.Wrapf(err, "app.containers[%d]", cn)
+		}
+
+		// process security shorthand
+		var containerAnnotations map[string]string
+		c, containerAnnotations, err = populateSecurityContext(c, defaultSecurity)
+		if err != nil {
+			return cnts, nil, errors.Wrapf(err, "app.containers[%d]", cn)
+		}
+		for k, v := range containerAnnotations {
+			annotations[k] = v
 		}
 
 		// this is where we are only taking apart upstream container
@@ -277,7 +440,7 @@ func populateContainers(containers []Container, cms []ConfigMapMod, secrets []Se
 
 	b, _ := json.MarshalIndent(cnts, "", "  ")
 	log.Debugf("containers after populating health: %s", string(b))
-	return cnts, nil
+	return cnts, annotations, nil
 }
 
 // Since we are automatically creating pvc from
@@ -149,6 +149,11 @@ func (app *ControllerFields) createServices() ([]runtime.Object, error) {
 			},
 			Spec: s.ServiceSpec,
 		}
+
+		if s.Headless {
+			svc.Spec.ClusterIP = api_v1.ClusterIPNone
+		}
+
 		for _, servicePortMod := range s.Ports {
 			svc.Spec.Ports = append(svc.Spec.Ports, servicePortMod.ServicePort)
 		}
@@ -294,6 +299,11 @@ func (app *ControllerFields) CreateK8sObjects() ([]runtime.Object, []string, err
 		app.Labels = app.getLabels()
 	}
 
+	app.populatePodSharing()
+	if err := validatePodSharing(app); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid pod sharing configuration")
+	}
+
 	svcs, err := app.createServices()
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "Unable to create Kubernetes Service")
@@ -304,23 +314,91 @@ func (app *ControllerFields) CreateK8sObjects() ([]runtime.Object, []string, err
 		return nil, nil, errors.Wrap(err, "Unable to create Kubernetes Ingresses")
 	}
 
+	app.Secrets, err = populateSecretSources(app.Secrets)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to resolve secret files/envs/literals")
+	}
+
 	secs, err := app.createSecrets()
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "Unable to create Kubernetes Secrets")
 	}
 
-	app.PodSpec.Containers, err = populateContainers(app.Containers, app.ConfigMaps, app.Secrets)
+	app.Routes, err = fixRoutes(app.Routes, app.Name)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to fix routes")
+	}
+
+	routes, err := app.createRoutes()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Unable to create OpenShift Routes")
+	}
+
+	builds, err := app.createBuilds()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Unable to create OpenShift BuildConfigs")
+	}
+
+	app.AwsServices, err = fixAwsServices(app.AwsServices, app.Name)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to fix aws services")
+	}
+	if err := validateAwsServices(app.AwsServices); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid aws services")
+	}
+
+	awsServices, err := app.createAwsServices()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Unable to create AWS service CRs")
+	}
+
+	for i := range app.Containers {
+		// CreateK8sObjects can run more than once over the same app (the
+		// controller re-generates on every reconcile), so drop any envs
+		// injected by a previous run before re-injecting rather than
+		// appending duplicates.
+		app.Containers[i].Env = removeEnvVars(app.Containers[i].Env, headlessEnvVarNames)
+		app.Containers[i].Env = append(app.Containers[i].Env, headlessServiceEnvVars(app.Services)...)
+	}
+
+	var containerAnnotations, initContainerAnnotations map[string]string
+	app.PodSpec.Containers, containerAnnotations, err = populateContainers(
+		app.Containers, app.ConfigMaps, app.Secrets, app.Defaults.Resources, app.Defaults.Security)
 	if err != nil {
 		return nil, nil, errors.Wrapf(err, "deployment %q", app.Name)
 	}
 	log.Debugf("object after population: %#v\n", app)
 
-	app.PodSpec.InitContainers, err = populateContainers(app.InitContainers, app.ConfigMaps, app.Secrets)
+	// The aws-service-operator populates each CR's connection secret
+	// (endpoint, credentials, ...) at runtime, so its keys aren't known at
+	// generate time. Wire the envFrom directly onto the generated
+	// PodSpec instead of routing it through populateContainers, which
+	// would try to expand it into explicit envs right now and fail
+	// because the secret doesn't exist yet.
+	for i := range app.PodSpec.Containers {
+		app.PodSpec.Containers[i].EnvFrom = append(app.PodSpec.Containers[i].EnvFrom, awsServiceEnvVars(app.AwsServices)...)
+	}
+
+	app.PodSpec.InitContainers, initContainerAnnotations, err = populateContainers(
+		app.InitContainers, app.ConfigMaps, app.Secrets, app.Defaults.Resources, app.Defaults.Security)
 	if err != nil {
 		return nil, nil, errors.Wrapf(err, "deployment %q", app.Name)
 	}
 	log.Debugf("object after population: %#v\n", app)
 
+	for k, v := range containerAnnotations {
+		if app.PodAnnotations == nil {
+			app.PodAnnotations = map[string]string{}
+		}
+		app.PodAnnotations[k] = v
+	}
+	for k, v := range initContainerAnnotations {
+		if app.PodAnnotations == nil {
+			app.PodAnnotations = map[string]string{}
+		}
+		app.PodAnnotations[k] = v
+	}
+
 	// create pvc for each root level persistent volume
 	pvcs, err := app.createPVC()
 	if err != nil {
@@ -346,8 +424,22 @@ func (app *ControllerFields) CreateK8sObjects() ([]runtime.Object, []string, err
 		configMap = append(configMap, cm)
 	}
 
+	// built only now that app.PodSpec holds the populated containers and volumes
+	controllerObject, err := app.CreateControllerObject()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Unable to create controller object")
+	}
+
 	// please keep the order of the artifacts addition as it is
 
+	// adding the controller object, e.g. a DeploymentConfig when
+	// app.Strategy is StrategyDeploymentConfig. It's nil for the default
+	// strategy, since the default Kubernetes Deployment isn't built here
+	// (see CreateControllerObject).
+	if controllerObject != nil {
+		objects = append(objects, controllerObject)
+	}
+
 	// adding non-controller objects
 	objects = append(objects, pvcs...)
 	log.Debugf("app: %s, pvc: %s\n", app.Name, spew.Sprint(pvcs))
@@ -364,9 +456,56 @@ func (app *ControllerFields) CreateK8sObjects() ([]runtime.Object, []string, err
 	objects = append(objects, configMap...)
 	log.Debugf("app: %s, configMap: %s\n", app.Name, spew.Sprint(configMap))
 
+	objects = append(objects, routes...)
+	log.Debugf("app: %s, route: %s\n", app.Name, spew.Sprint(routes))
+
+	objects = append(objects, builds...)
+	log.Debugf("app: %s, build: %s\n", app.Name, spew.Sprint(builds))
+
+	objects = append(objects, awsServices...)
+	log.Debugf("app: %s, awsService: %s\n", app.Name, spew.Sprint(awsServices))
+
 	return objects, app.ExtraResources, nil
 }
 
+// populatePodSharing copies the App-root sharing fields onto the generated
+// PodSpec, mirroring what podman's ToPodOpt derives from a pod's own spec.
+func (app *ControllerFields) populatePodSharing() {
+	app.PodSpec.ShareProcessNamespace = app.ShareProcessNamespace
+	app.PodSpec.HostNetwork = app.HostNetwork
+	app.PodSpec.HostIPC = app.HostIPC
+	app.PodSpec.HostPID = app.HostPID
+	app.PodSpec.Hostname = app.Hostname
+	app.PodSpec.Subdomain = app.Subdomain
+}
+
+// validatePodSharing rejects combinations of the pod-sharing fields that
+// would produce a broken deployment, e.g. hostNetwork without a way for the
+// Service to actually reach the containers.
+func validatePodSharing(app *ControllerFields) error {
+	if app.HostNetwork {
+		for _, s := range app.Services {
+			isClusterIP := s.ServiceSpec.Type == "" || s.ServiceSpec.Type == api_v1.ServiceTypeClusterIP
+			if isClusterIP && !hasHostPortMapping(app.Containers) {
+				return fmt.Errorf("app %q: hostNetwork is set but service %q is ClusterIP with no hostPort mapping on any container",
+					app.Name, s.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func hasHostPortMapping(containers []Container) bool {
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.HostPort != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Validate
 
 func validateVolumeClaims(vcs []VolumeClaim) error {
@@ -0,0 +1,104 @@
+/*
+Copyright 2017 The Kedge Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"fmt"
+
+	units "github.com/docker/go-units"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	api_v1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// ResourceSpec is the docker/podman-style human-readable shorthand for a
+// container's resource requests/limits, e.g. `memory: 512m`, `cpus: 0.5`.
+type ResourceSpec struct {
+	CPUs              string `json:"cpus,omitempty"`
+	Memory            string `json:"memory,omitempty"`
+	MemoryReservation string `json:"memory-reservation,omitempty"`
+}
+
+// populateResources translates a container's human-readable ResourceSpec
+// (and the App-level defaults.resources fallback) into the
+// api_v1.ResourceRequirements the generated Container carries, validating
+// that limits are never lower than requests.
+func populateResources(c Container, defaults ResourceSpec) (Container, error) {
+	spec := c.Resources
+	if spec.CPUs == "" && spec.Memory == "" && spec.MemoryReservation == "" {
+		spec = defaults
+	}
+
+	limits, err := toResourceList(spec.CPUs, spec.Memory)
+	if err != nil {
+		return c, errors.Wrap(err, "limits")
+	}
+
+	requests, err := toResourceList("", spec.MemoryReservation)
+	if err != nil {
+		return c, errors.Wrap(err, "requests")
+	}
+
+	if err := validateLimitsAboveRequests(limits, requests); err != nil {
+		return c, err
+	}
+
+	if len(limits) > 0 {
+		c.Container.Resources.Limits = limits
+	}
+	if len(requests) > 0 {
+		c.Container.Resources.Requests = requests
+	}
+	return c, nil
+}
+
+// toResourceList converts human units (`512m`, `0.5`) into a ResourceList,
+// the way docker-compose/podman accept cpus and memory shorthand.
+func toResourceList(cpus, memory string) (api_v1.ResourceList, error) {
+	list := api_v1.ResourceList{}
+
+	if cpus != "" {
+		q, err := resource.ParseQuantity(cpus)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cpus %q", cpus)
+		}
+		list[api_v1.ResourceCPU] = q
+	}
+
+	if memory != "" {
+		bytes, err := units.RAMInBytes(memory)
+		if err != nil {
+			return nil, errors.Wrapf(err, "memory %q", memory)
+		}
+		list[api_v1.ResourceMemory] = *resource.NewQuantity(bytes, resource.BinarySI)
+	}
+
+	return list, nil
+}
+
+func validateLimitsAboveRequests(limits, requests api_v1.ResourceList) error {
+	for name, req := range requests {
+		lim, ok := limits[name]
+		if !ok {
+			continue
+		}
+		if lim.Cmp(req) < 0 {
+			return fmt.Errorf("resource %q: limit %s is less than request %s", name, lim.String(), req.String())
+		}
+	}
+	return nil
+}
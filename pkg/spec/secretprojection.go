@@ -0,0 +1,100 @@
+/*
+Copyright 2017 The Kedge Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// SecretSources lets a SecretMod's data be assembled from local files,
+// environment variables, or literal key=value pairs at conversion time,
+// instead of requiring the user to hand-encode the Secret's payload.
+type SecretSources struct {
+	// Files are read from the local filesystem; each entry's basename
+	// becomes the Secret key, and its contents become the value.
+	Files []string `json:"files,omitempty"`
+	// Envs are read from the local environment; each name becomes both
+	// the Secret key and the name of the variable read.
+	Envs []string `json:"envs,omitempty"`
+	// Literals are copied verbatim into the Secret's data.
+	Literals map[string]string `json:"literals,omitempty"`
+}
+
+// populateSecretSources resolves each SecretMod's Files/Envs/Literals into a
+// fresh Data map, so downstream code (createSecrets, getSecretDataKeys,
+// convertEnvFromToEnvs) sees the resulting keys exactly as if the user had
+// written them out by hand. It never writes back into the SecretMod's
+// original Data map, since the same SecretMod can be resolved more than
+// once (e.g. the controller re-runs CreateK8sObjects on every reconcile of
+// the same spec) and mutating it in place would make the second resolution
+// see its own output as a pre-existing collision.
+func populateSecretSources(secrets []SecretMod) ([]SecretMod, error) {
+	for i, s := range secrets {
+		data := make(map[string][]byte, len(s.Data))
+		for k, v := range s.Data {
+			data[k] = v
+		}
+
+		for _, path := range s.Sources.Files {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "secret %q: reading file %q", s.Name, path)
+			}
+			key := filepath.Base(path)
+			if err := setSourcedKey(data, key, content, fmt.Sprintf("file %q", path)); err != nil {
+				return nil, errors.Wrapf(err, "secret %q", s.Name)
+			}
+		}
+
+		for _, name := range s.Sources.Envs {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return nil, fmt.Errorf("secret %q: environment variable %q is not set", s.Name, name)
+			}
+			if err := setSourcedKey(data, name, []byte(value), fmt.Sprintf("env %q", name)); err != nil {
+				return nil, errors.Wrapf(err, "secret %q", s.Name)
+			}
+		}
+
+		for key, value := range s.Sources.Literals {
+			if err := setSourcedKey(data, key, []byte(value), "literal"); err != nil {
+				return nil, errors.Wrapf(err, "secret %q", s.Name)
+			}
+		}
+
+		s.Data = data
+		secrets[i] = s
+	}
+	return secrets, nil
+}
+
+// setSourcedKey adds key/value to data, unless key is already present with a
+// different value, in which case it's a genuine collision between two
+// sources rather than the same source being resolved again.
+func setSourcedKey(data map[string][]byte, key string, value []byte, source string) error {
+	if existing, exists := data[key]; exists && !bytes.Equal(existing, value) {
+		return fmt.Errorf("key %q already defined, %s collides with it", key, source)
+	}
+	data[key] = value
+	return nil
+}
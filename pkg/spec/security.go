@@ -0,0 +1,127 @@
+/*
+Copyright 2017 The Kedge Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	api_v1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// SecuritySpec is the shorthand accepted on a Container (and as an App-level
+// default) that expands into a full SecurityContext during populateContainers.
+type SecuritySpec struct {
+	ReadOnlyRootFilesystem *bool                 `json:"readOnlyRootFilesystem,omitempty"`
+	RunAsNonRoot           *bool                 `json:"runAsNonRoot,omitempty"`
+	RunAsUser              *int64                `json:"runAsUser,omitempty"`
+	Capabilities           *SecurityCapabilities `json:"capabilities,omitempty"`
+	// SeccompProfile is either "runtime/default" or a path to a local
+	// JSON profile; the file is read and checked to be valid JSON, and a
+	// "localhost/<path>" reference to it is attached as a pod annotation.
+	SeccompProfile string `json:"seccompProfile,omitempty"`
+}
+
+// SecurityCapabilities mirrors api_v1.Capabilities but accepts plain
+// strings instead of api_v1.Capability, matching the rest of the Kedge
+// shorthand types.
+type SecurityCapabilities struct {
+	Add  []string `json:"add,omitempty"`
+	Drop []string `json:"drop,omitempty"`
+}
+
+// seccompAnnotationPrefix matches podman's pkg/specgen/generate/kube/seccomp.go
+// convention for attaching a per-container seccomp profile via annotation.
+const seccompAnnotationPrefix = "container.seccomp.security.alpha.kubernetes.io/"
+
+// populateSecurityContext expands a container's security shorthand (falling
+// back to the App-level default when the container doesn't set one of its
+// own) into a proper SecurityContext, and returns any seccomp annotation
+// that needs to land on the pod template.
+func populateSecurityContext(c Container, defaults SecuritySpec) (Container, map[string]string, error) {
+	spec := c.Security
+	if isSecuritySpecEmpty(spec) {
+		spec = defaults
+	}
+
+	if err := validateSecuritySpec(spec); err != nil {
+		return c, nil, err
+	}
+
+	sc := &api_v1.SecurityContext{
+		ReadOnlyRootFilesystem: spec.ReadOnlyRootFilesystem,
+		RunAsNonRoot:           spec.RunAsNonRoot,
+		RunAsUser:              spec.RunAsUser,
+	}
+
+	if spec.Capabilities != nil {
+		sc.Capabilities = &api_v1.Capabilities{
+			Add:  toCapabilities(spec.Capabilities.Add),
+			Drop: toCapabilities(spec.Capabilities.Drop),
+		}
+	}
+
+	c.Container.SecurityContext = sc
+
+	var annotations map[string]string
+	if spec.SeccompProfile != "" {
+		profile := spec.SeccompProfile
+		if profile != "runtime/default" {
+			content, err := ioutil.ReadFile(profile)
+			if err != nil {
+				return c, nil, errors.Wrapf(err, "container %q: reading seccomp profile %q", c.Name, profile)
+			}
+			if !json.Valid(content) {
+				return c, nil, errors.Errorf("container %q: seccomp profile %q is not valid JSON", c.Name, profile)
+			}
+			// The annotation is a reference kubelet resolves against
+			// /var/lib/kubelet/seccomp on the node, not the profile
+			// contents, so the file still needs to be shipped there
+			// separately (e.g. via a DaemonSet or baked into the node image).
+			profile = "localhost/" + profile
+		}
+		annotations = map[string]string{
+			seccompAnnotationPrefix + c.Name: profile,
+		}
+	}
+
+	return c, annotations, nil
+}
+
+func isSecuritySpecEmpty(s SecuritySpec) bool {
+	return s.ReadOnlyRootFilesystem == nil && s.RunAsNonRoot == nil &&
+		s.RunAsUser == nil && s.Capabilities == nil && s.SeccompProfile == ""
+}
+
+// validateSecuritySpec rejects mutually-exclusive settings at
+// spec-conversion time rather than letting the apiserver reject them later.
+func validateSecuritySpec(s SecuritySpec) error {
+	if s.RunAsNonRoot != nil && *s.RunAsNonRoot && s.RunAsUser != nil && *s.RunAsUser == 0 {
+		return fmt.Errorf("cannot set 'runAsNonRoot: true' together with 'runAsUser: 0'")
+	}
+	return nil
+}
+
+func toCapabilities(in []string) []api_v1.Capability {
+	var out []api_v1.Capability
+	for _, c := range in {
+		out = append(out, api_v1.Capability(c))
+	}
+	return out
+}